@@ -0,0 +1,141 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// maxToolOutputBytes bounds how much of a tool's output gets fed back to
+// the model as a tool-role message; truncating keeps a verbose command or
+// large file from blowing the conversation's token budget.
+const maxToolOutputBytes = 16 * 1024
+
+// runCommandTimeout bounds how long a model-triggered shell command may
+// run before it's killed.
+const runCommandTimeout = 30 * time.Second
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "run-command",
+		Description: "Run a shell command on the user's machine and return its combined stdout/stderr.",
+		JSONSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{
+					"type":        "string",
+					"description": "The shell command to run.",
+				},
+			},
+			"required": []string{"command"},
+		},
+		Handler: runCommandHandler,
+	})
+	RegisterTool(Tool{
+		Name:        "read-file",
+		Description: "Read a text file from the user's machine and return its contents.",
+		JSONSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{
+					"type":        "string",
+					"description": "Absolute or relative path to the file to read.",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Handler: readFileHandler,
+	})
+	RegisterTool(Tool{
+		Name:        "list-blocks",
+		Description: "List the metadata keys stored on the current block (values are omitted so secrets like ai:apitoken can't leak back to the model).",
+		JSONSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+		Handler: listBlocksHandler,
+	})
+}
+
+// runCommandHandler is gated by validation.ValidateCommand in executeTool
+// before this ever runs.
+func runCommandHandler(ctx context.Context, blockId string, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, runCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, "sh", "-c", args.Command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("command failed: %v\noutput:\n%s", err, truncateToolOutput(output)), nil
+	}
+	return truncateToolOutput(output), nil
+}
+
+// readFileHandler is gated by checkReadFileAllowlist in executeTool before
+// this ever runs.
+func readFileHandler(ctx context.Context, blockId string, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if args.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	data, err := os.ReadFile(args.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", args.Path, err)
+	}
+	return truncateToolOutput(data), nil
+}
+
+// listBlocksHandler reports the invoking block's own metadata keys. There's
+// no workspace-wide block listing API to call into here, so this is scoped
+// to the one block the tool call is already running against.
+func listBlocksHandler(ctx context.Context, blockId string, rawArgs json.RawMessage) (string, error) {
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up block %s: %v", blockId, err)
+	}
+
+	keys := make([]string, 0, len(block.Meta))
+	for key := range block.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out, err := json.Marshal(map[string]any{
+		"blockId":  blockId,
+		"metaKeys": keys,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal block info: %v", err)
+	}
+	return string(out), nil
+}
+
+func truncateToolOutput(data []byte) string {
+	if len(data) > maxToolOutputBytes {
+		data = data[:maxToolOutputBytes]
+	}
+	return string(data)
+}
@@ -0,0 +1,213 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+)
+
+const (
+	// maxImageBytes bounds the size of an inline (base64 data URL) image
+	// attachment we'll forward upstream. Remote image URLs aren't fetched
+	// here, so this only applies to data URLs.
+	maxImageBytes = 5 * 1024 * 1024
+
+	// maxImageDimension is the longest edge we'll forward without
+	// downscaling first. Most vision models internally tile/resize to
+	// something in this neighborhood anyway, so sending anything larger
+	// just burns upload bandwidth and upstream tokens.
+	maxImageDimension = 2048
+)
+
+// allowedImageMimeTypes are the attachment types HandleAIChat will accept.
+// webp decoding isn't in the stdlib image package, so webp attachments are
+// size/mime validated but never downscaled.
+var allowedImageMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// visionCapableModelSubstrings are matched against the configured model id
+// via strings.Contains, so "gpt-4o-mini", "gpt-4o-2024-08-06", etc. all
+// match a single "gpt-4o" entry without needing an exhaustive alias list.
+var visionCapableModelSubstrings = []string{
+	"gpt-4o",
+	"gpt-4-vision",
+	"gpt-4-turbo",
+	"claude-3",
+	"claude-opus-4",
+	"claude-sonnet-4",
+	"gemini-1.5",
+	"gemini-2",
+}
+
+// modelSupportsVision reports whether model is known to accept image
+// inputs. Unrecognized models are assumed not to, since sending
+// MultiContent to a model that doesn't support it is an upstream error.
+func modelSupportsVision(model string) bool {
+	for _, substr := range visionCapableModelSubstrings {
+		if strings.Contains(model, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageAttachment is an image reference normalized out of a UseChatMessagePart,
+// ready to validate and forward upstream as a ChatMessagePartTypeImageURL.
+type imageAttachment struct {
+	url      string // a "data:" URL or a remote http(s) URL
+	mimeType string
+}
+
+// asImageAttachment extracts an imageAttachment from an "image" part
+// (image_url or base64 data) or an image-flavored "file" part (Vercel AI
+// SDK UIMessage format), or reports ok=false if the part isn't an image.
+func (p UseChatMessagePart) asImageAttachment() (imageAttachment, bool) {
+	switch p.Type {
+	case "image":
+		if p.ImageURL != "" {
+			return imageAttachment{url: p.ImageURL, mimeType: p.MimeType}, true
+		}
+		if p.Data != "" {
+			mimeType := p.MimeType
+			if mimeType == "" {
+				mimeType = "image/png"
+			}
+			return imageAttachment{url: fmt.Sprintf("data:%s;base64,%s", mimeType, p.Data), mimeType: mimeType}, true
+		}
+	case "file":
+		if p.URL != "" && strings.HasPrefix(p.MediaType, "image/") {
+			return imageAttachment{url: p.URL, mimeType: p.MediaType}, true
+		}
+	}
+	return imageAttachment{}, false
+}
+
+// prepareImageForUpstream validates an inbound image attachment and, for
+// inline data URLs, downscales it if it exceeds maxImageDimension in
+// either axis. Remote image URLs are passed through unvalidated since
+// fetching and decoding them here would add a second round trip to every
+// vision request; it's still the upstream API that rejects oversized or
+// unsupported remote images.
+func prepareImageForUpstream(att imageAttachment) (string, error) {
+	if !strings.HasPrefix(att.url, "data:") {
+		return att.url, nil
+	}
+
+	mediaType, data, err := parseDataURL(att.url)
+	if err != nil {
+		return "", err
+	}
+	mimeType := att.mimeType
+	if mimeType == "" {
+		mimeType = mediaType
+	}
+	if !allowedImageMimeTypes[mimeType] {
+		return "", fmt.Errorf("unsupported image type %q", mimeType)
+	}
+	if len(data) > maxImageBytes {
+		return "", fmt.Errorf("image exceeds maximum size of %d bytes", maxImageBytes)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// Undecodable with the stdlib codecs we registered (e.g. webp):
+		// forward as-is rather than failing the whole request.
+		return att.url, nil
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxImageDimension && bounds.Dy() <= maxImageDimension {
+		return att.url, nil
+	}
+
+	resized := downscaleImage(img, maxImageDimension)
+	var buf bytes.Buffer
+	if format == "png" {
+		err = png.Encode(&buf, resized)
+	} else {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		mimeType = "image/jpeg"
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to re-encode downscaled image: %v", err)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// parseDataURL splits a "data:<mediaType>;base64,<data>" URL into its MIME
+// type and decoded bytes.
+func parseDataURL(raw string) (mediaType string, data []byte, err error) {
+	rest := strings.TrimPrefix(raw, "data:")
+	comma := strings.IndexByte(rest, ',')
+	if comma < 0 {
+		return "", nil, fmt.Errorf("malformed data URL")
+	}
+	meta := rest[:comma]
+	if !strings.HasSuffix(meta, ";base64") {
+		return "", nil, fmt.Errorf("only base64-encoded data URLs are supported")
+	}
+	mediaType = strings.TrimSuffix(meta, ";base64")
+	data, err = base64.StdEncoding.DecodeString(rest[comma+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid base64 image data: %v", err)
+	}
+	return mediaType, data, nil
+}
+
+// splitDataURLBase64 extracts the media type and still-base64-encoded
+// payload from a "data:<mediaType>;base64,<data>" URL, without decoding
+// it. Callers that just need to forward the base64 payload as-is (e.g.
+// Anthropic's image source blocks) don't need parseDataURL's decode step.
+func splitDataURLBase64(raw string) (mediaType string, base64Data string, ok bool) {
+	rest := strings.TrimPrefix(raw, "data:")
+	comma := strings.IndexByte(rest, ',')
+	if comma < 0 {
+		return "", "", false
+	}
+	meta := rest[:comma]
+	if !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), rest[comma+1:], true
+}
+
+// downscaleImage resizes img so neither dimension exceeds max, preserving
+// aspect ratio. Nearest-neighbor sampling is good enough for shrinking chat
+// attachments; we don't need a resampling library's higher-quality filters
+// here.
+func downscaleImage(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := float64(max) / float64(w)
+	if h > w {
+		scale = float64(max) / float64(h)
+	}
+	newW, newH := int(float64(w)*scale), int(float64(h)*scale)
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	for y := 0; y < newH; y++ {
+		srcY := bounds.Min.Y + y*h/newH
+		for x := 0; x < newW; x++ {
+			srcX := bounds.Min.X + x*w/newW
+			dst.Set(x, y, img.At(srcX, srcY))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,62 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// API type identifiers for ai:apitype. resolveAIConfig reads this value out
+// of the preset/block/global hierarchy and getAIProvider dispatches on it.
+const (
+	APIType_OpenAI    = "openai"
+	APIType_Anthropic = "anthropic"
+	APIType_Azure     = "azure"
+	APIType_Cohere    = "cohere"
+	APIType_Local     = "local"
+)
+
+// AIProvider is implemented by each supported AI backend. StreamChat
+// translates the provider's native streaming protocol into UseChat SSE
+// frames (writeMessageStart/writeTextStart/writeUseChatTextDelta/...)
+// written directly to w, so every provider produces the same wire format
+// regardless of how it talks to its upstream API. messageId is caller-
+// assigned (rather than generated internally) so it can double as the
+// chat session key a reconnecting client resumes against.
+type AIProvider interface {
+	StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error
+}
+
+// getAIProvider resolves the AIProvider for the given ai:apitype value.
+// An empty apiType defaults to OpenAI for backwards compatibility with
+// configs written before this dispatch existed.
+func getAIProvider(apiType string) (AIProvider, error) {
+	switch apiType {
+	case "", APIType_OpenAI:
+		return openAIProvider{}, nil
+	case APIType_Anthropic:
+		return anthropicProvider{}, nil
+	case APIType_Azure:
+		return azureProvider{}, nil
+	case APIType_Cohere:
+		return cohereProvider{}, nil
+	case APIType_Local:
+		return localProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported API type: %s", apiType)
+	}
+}
+
+// openAIProvider adapts the original OpenAI-only streaming implementation
+// to the AIProvider interface.
+type openAIProvider struct{}
+
+func (openAIProvider) StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error {
+	streamOpenAIToUseChat(w, ctx, blockId, messageId, opts, messages)
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const (
+	anthropicAPIVersion     = "2023-06-01"
+	anthropicDefaultBaseURL = "https://api.anthropic.com/v1/messages"
+)
+
+// anthropicProvider talks to the Anthropic Messages API directly since
+// go-openai has no Anthropic support. It authenticates with x-api-key and
+// anthropic-version headers and consumes the API's "event:"-prefixed SSE
+// stream.
+type anthropicProvider struct{}
+
+// Content is a string for plain text turns, or a []map[string]any of
+// content blocks (text + image) for multimodal ones -- the Anthropic
+// Messages API accepts either shape.
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// anthropicThinking requests extended thinking on models that support it;
+// the model streams its reasoning back as "thinking_delta" content blocks
+// ahead of the answer's "text_delta" blocks.
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicStreamRequest struct {
+	Model     string             `json:"model"`
+	Messages  []anthropicMessage `json:"messages"`
+	System    string             `json:"system,omitempty"`
+	MaxTokens int                `json:"max_tokens"`
+	Stream    bool               `json:"stream"`
+	Thinking  *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+	} `json:"delta"`
+}
+
+// extendedThinkingModelPrefixes are the Claude models known to support
+// extended thinking.
+var extendedThinkingModelPrefixes = []string{
+	"claude-opus-4",
+	"claude-sonnet-4",
+	"claude-3-7-sonnet",
+}
+
+// defaultThinkingBudgetTokens is a conservative default for the budget
+// Anthropic requires alongside "thinking": {"type": "enabled"}. It leaves
+// most of MaxTokens free for the answer itself.
+const defaultThinkingBudgetTokens = 1024
+
+func supportsExtendedThinking(model string) bool {
+	for _, prefix := range extendedThinkingModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildAnthropicContentBlocks turns a message's text and image attachments
+// into Anthropic's content-block array: an optional "text" block followed
+// by one "image" block per attachment, each validated/downscaled via
+// prepareImageForUpstream the same way the OpenAI-compatible path does.
+// An attachment that fails validation is dropped rather than failing the
+// whole turn.
+func buildAnthropicContentBlocks(content string, images []imageAttachment) []map[string]any {
+	var blocks []map[string]any
+	if content != "" {
+		blocks = append(blocks, map[string]any{"type": "text", "text": content})
+	}
+	for _, img := range images {
+		preparedURL, err := prepareImageForUpstream(img)
+		if err != nil {
+			log.Printf("skipping invalid image attachment: %v", err)
+			continue
+		}
+		if mediaType, data, ok := splitDataURLBase64(preparedURL); ok {
+			blocks = append(blocks, map[string]any{
+				"type": "image",
+				"source": map[string]any{
+					"type":       "base64",
+					"media_type": mediaType,
+					"data":       data,
+				},
+			})
+			continue
+		}
+		blocks = append(blocks, map[string]any{
+			"type": "image",
+			"source": map[string]any{
+				"type": "url",
+				"url":  preparedURL,
+			},
+		})
+	}
+	return blocks
+}
+
+func (anthropicProvider) StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error {
+	// writeMessageStart runs before any of the marshal/request/upstream
+	// steps below that can return an error, so HandleAIChat's
+	// writeUseChatError fallback always has a preceding "start" frame to
+	// attach the error to instead of sending a bare error frame.
+	writeMessageStart(w, messageId)
+	tryFlush(w)
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+
+	var system string
+	var anthMessages []anthropicMessage
+	for _, msg := range messages {
+		content := msg.GetContent()
+		images := msg.GetImageAttachments()
+		if strings.TrimSpace(content) == "" && len(images) == 0 {
+			continue
+		}
+		if msg.Role == "system" {
+			system = content
+			continue
+		}
+		if len(images) > 0 && modelSupportsVision(opts.Model) {
+			anthMessages = append(anthMessages, anthropicMessage{Role: msg.Role, Content: buildAnthropicContentBlocks(content, images)})
+			continue
+		}
+		anthMessages = append(anthMessages, anthropicMessage{Role: msg.Role, Content: content})
+	}
+
+	maxTokens := opts.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4000
+	}
+
+	var thinking *anthropicThinking
+	if supportsExtendedThinking(opts.Model) {
+		thinking = &anthropicThinking{Type: "enabled", BudgetTokens: defaultThinkingBudgetTokens}
+	}
+
+	bodyBytes, err := json.Marshal(anthropicStreamRequest{
+		Model:     opts.Model,
+		Messages:  anthMessages,
+		System:    system,
+		MaxTokens: maxTokens,
+		Stream:    true,
+		Thinking:  thinking,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Anthropic request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create Anthropic request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", opts.APIToken)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("Anthropic API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Anthropic API error: status %d", resp.StatusCode)
+	}
+
+	textId := generateID()
+	reasoningId := generateID()
+
+	textStarted := false
+	textEnded := false
+	reasoningStarted := false
+	reasoningEnded := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var eventType string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "" {
+				continue
+			}
+			var evt anthropicStreamEvent
+			if err := json.Unmarshal([]byte(data), &evt); err != nil {
+				continue
+			}
+			switch eventType {
+			case "content_block_delta":
+				switch {
+				case evt.Delta.Type == "thinking_delta" && evt.Delta.Thinking != "":
+					if !reasoningStarted {
+						writeReasoningStart(w, reasoningId)
+						reasoningStarted = true
+					}
+					writeReasoningDelta(w, reasoningId, evt.Delta.Thinking)
+				case evt.Delta.Type == "text_delta" && evt.Delta.Text != "":
+					// The thinking block always closes before the answer's
+					// text block opens, so close reasoning here if it's
+					// still open.
+					if reasoningStarted && !reasoningEnded {
+						writeReasoningEnd(w, reasoningId)
+						reasoningEnded = true
+					}
+					if !textStarted {
+						writeTextStart(w, textId)
+						textStarted = true
+					}
+					writeUseChatTextDelta(w, textId, evt.Delta.Text)
+				}
+			case "message_stop":
+				if reasoningStarted && !reasoningEnded {
+					writeReasoningEnd(w, reasoningId)
+					reasoningEnded = true
+				}
+				if textStarted && !textEnded {
+					writeTextEnd(w, textId)
+					textEnded = true
+				}
+				writeOpenAIFinish(w, "stop", nil)
+			}
+			tryFlush(w)
+		}
+	}
+
+	if reasoningStarted && !reasoningEnded {
+		writeReasoningEnd(w, reasoningId)
+	}
+	if textStarted && !textEnded {
+		writeTextEnd(w, textId)
+	}
+	writeUseChatDone(w)
+	return nil
+}
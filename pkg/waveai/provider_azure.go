@@ -0,0 +1,47 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// azureProvider targets an Azure OpenAI resource. Azure speaks the same
+// chat completion wire protocol as OpenAI but routes by deployment name
+// and expects an api-version query parameter, both of which go-openai
+// handles once the client is configured for APITypeAzure.
+type azureProvider struct{}
+
+func (azureProvider) StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error {
+	if opts.BaseURL == "" {
+		// streamOpenAIClientToUseChat below emits "start" before it can
+		// ever error, but we return before ever reaching it, so emit it
+		// here too -- HandleAIChat's writeUseChatError fallback otherwise
+		// sends an error frame with no preceding "start" for the client to
+		// attach it to.
+		writeMessageStart(w, messageId)
+		tryFlush(w)
+		return fmt.Errorf("Azure OpenAI requires ai:baseurl to be set to the resource endpoint")
+	}
+
+	clientConfig := openaiapi.DefaultAzureConfig(opts.APIToken, opts.BaseURL)
+	if opts.APIVersion != "" {
+		clientConfig.APIVersion = opts.APIVersion
+	}
+	// Azure deployments are named independently of the underlying model,
+	// so ai:model is treated as the deployment name.
+	deployment := opts.Model
+	clientConfig.AzureModelMapperFunc = func(model string) string {
+		return deployment
+	}
+
+	client := openaiapi.NewClientWithConfig(clientConfig)
+	streamOpenAIClientToUseChat(w, ctx, blockId, messageId, client, opts, messages)
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const cohereDefaultBaseURL = "https://api.cohere.com/v1/chat"
+
+// cohereProvider talks to Cohere's chat API, which streams newline-
+// delimited JSON objects discriminated by an "event_type" field rather
+// than SSE "event:" lines.
+type cohereProvider struct{}
+
+type cohereChatMessage struct {
+	Role    string `json:"role"`
+	Message string `json:"message"`
+}
+
+type cohereChatRequest struct {
+	Model       string              `json:"model,omitempty"`
+	Message     string              `json:"message"`
+	ChatHistory []cohereChatMessage `json:"chat_history,omitempty"`
+	Stream      bool                `json:"stream"`
+}
+
+type cohereStreamEvent struct {
+	EventType string `json:"event_type"`
+	Text      string `json:"text"`
+}
+
+func (cohereProvider) StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error {
+	// writeMessageStart runs before any of the marshal/request/upstream
+	// steps below that can return an error, so HandleAIChat's
+	// writeUseChatError fallback always has a preceding "start" frame to
+	// attach the error to instead of sending a bare error frame.
+	writeMessageStart(w, messageId)
+	tryFlush(w)
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = cohereDefaultBaseURL
+	}
+
+	var history []cohereChatMessage
+	for _, msg := range messages {
+		content := msg.GetContent()
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		role := "USER"
+		switch msg.Role {
+		case "assistant":
+			role = "CHATBOT"
+		case "system":
+			role = "SYSTEM"
+		}
+		history = append(history, cohereChatMessage{Role: role, Message: content})
+	}
+
+	// Cohere splits the running conversation into chat_history plus the
+	// latest user turn passed separately as message.
+	var lastMessage string
+	if len(history) > 0 {
+		lastMessage = history[len(history)-1].Message
+		history = history[:len(history)-1]
+	}
+
+	bodyBytes, err := json.Marshal(cohereChatRequest{
+		Model:       opts.Model,
+		Message:     lastMessage,
+		ChatHistory: history,
+		Stream:      true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Cohere request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create Cohere request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+opts.APIToken)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("Cohere API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Cohere API error: status %d", resp.StatusCode)
+	}
+
+	textId := generateID()
+
+	textStarted := false
+	textEnded := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var evt cohereStreamEvent
+		if err := json.Unmarshal([]byte(line), &evt); err != nil {
+			continue
+		}
+		switch evt.EventType {
+		case "text-generation":
+			if evt.Text != "" {
+				if !textStarted {
+					writeTextStart(w, textId)
+					textStarted = true
+				}
+				writeUseChatTextDelta(w, textId, evt.Text)
+			}
+		case "stream-end":
+			if textStarted && !textEnded {
+				writeTextEnd(w, textId)
+				textEnded = true
+			}
+			writeOpenAIFinish(w, "stop", nil)
+		}
+		tryFlush(w)
+	}
+
+	if textStarted && !textEnded {
+		writeTextEnd(w, textId)
+	}
+	writeUseChatDone(w)
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"net/http"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const localDefaultBaseURL = "http://localhost:11434/v1"
+
+// localProvider targets llama.cpp's server and Ollama, both of which
+// expose an OpenAI-compatible chat completions endpoint, so it reuses the
+// same streaming path as the OpenAI and Azure providers.
+type localProvider struct{}
+
+func (localProvider) StreamChat(ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage, w http.ResponseWriter) error {
+	token := opts.APIToken
+	if token == "" {
+		// Local servers typically don't check the key, but the client
+		// library requires a non-empty one.
+		token = "local"
+	}
+
+	clientConfig := openaiapi.DefaultConfig(token)
+	clientConfig.BaseURL = opts.BaseURL
+	if clientConfig.BaseURL == "" {
+		clientConfig.BaseURL = localDefaultBaseURL
+	}
+
+	client := openaiapi.NewClientWithConfig(clientConfig)
+	streamOpenAIClientToUseChat(w, ctx, blockId, messageId, client, opts, messages)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/waveai/ratelimit"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// aiChatLimiter is shared across all requests to HandleAIChat for the
+// lifetime of the process; its buckets are keyed per-IP/per-block/per-token
+// internally, so a single process-wide instance is correct.
+var aiChatLimiter = ratelimit.NewLimiter(ratelimit.DefaultConfig())
+
+// checkAIChatRateLimit applies the rate limiter using the current
+// ai:ratelimit:* settings, the caller's remote IP, the target block, and
+// the resolved API token.
+func checkAIChatRateLimit(r *http.Request, blockId string, apiToken string) ratelimit.Result {
+	applyRateLimitSettings(wconfig.GetWatcher().GetFullConfig())
+	return aiChatLimiter.Check(clientIP(r), blockId, apiToken)
+}
+
+// applyRateLimitSettings refreshes the limiter's config from the latest
+// ai:ratelimit:* settings. Existing buckets keep their accumulated state;
+// only the limits they refill against change.
+func applyRateLimitSettings(fullConfig wconfig.FullConfigType) {
+	config := ratelimit.DefaultConfig()
+	settings := fullConfig.Settings
+
+	if settings.AiRateLimitDisabled {
+		config.Disabled = true
+	}
+	if settings.AiRateLimitBlockPerMin > 0 {
+		config.BlockLimit = ratelimit.Limit{Burst: settings.AiRateLimitBlockPerMin, Window: time.Minute}
+	}
+	if settings.AiRateLimitIPPerWindow > 0 {
+		windowMin := settings.AiRateLimitIPWindowMin
+		if windowMin <= 0 {
+			windowMin = 15
+		}
+		config.IPLimit = ratelimit.Limit{Burst: settings.AiRateLimitIPPerWindow, Window: time.Duration(windowMin) * time.Minute}
+	}
+
+	aiChatLimiter.UpdateConfig(config)
+}
+
+// clientIP extracts the caller's address for rate limiting purposes,
+// preferring X-Forwarded-For (set by Wave's local proxy) over RemoteAddr.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		parts := strings.Split(fwd, ",")
+		return strings.TrimSpace(parts[0])
+	}
+	host := r.RemoteAddr
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return host
+}
+
+// writeRateLimitExceeded sends a 429 with Retry-After and standard
+// RateLimit-* headers. It must run before any SSE headers are written,
+// since it uses a normal (non-streaming) error response.
+func writeRateLimitExceeded(w http.ResponseWriter, result ratelimit.Result) {
+	h := w.Header()
+	h.Set("Retry-After", ratelimit.RetryAfterHeader(result.RetryAfter))
+	h.Set("RateLimit-Limit", fmt.Sprintf("%d", result.Limit))
+	h.Set("RateLimit-Remaining", fmt.Sprintf("%d", result.Remaining))
+	h.Set("RateLimit-Reset", ratelimit.RetryAfterHeader(result.RetryAfter))
+	http.Error(w, fmt.Sprintf("AI rate limit exceeded (%s), retry after %s", result.Scope, ratelimit.RetryAfterHeader(result.RetryAfter)+"s"), http.StatusTooManyRequests)
+}
@@ -0,0 +1,214 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimit implements token-bucket rate limiting for the AI chat
+// endpoint, keyed independently by remote IP, block ID, and API token so
+// that a single leaked credential or misbehaving block can't starve every
+// other caller sharing the process.
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: Burst tokens refilled over Window.
+type Limit struct {
+	Burst  int
+	Window time.Duration
+}
+
+// Default limits, overridden by ai:ratelimit:* settings via Config.
+var (
+	DefaultBlockLimit = Limit{Burst: 20, Window: time.Minute}
+	DefaultIPLimit    = Limit{Burst: 100, Window: 15 * time.Minute}
+)
+
+// Config mirrors the ai:ratelimit:* settings keys. TokenLimit has no
+// settings key and DefaultConfig leaves it zero, so the per-token bucket
+// is only applied when a caller sets TokenLimit.Burst explicitly.
+type Config struct {
+	BlockLimit Limit
+	IPLimit    Limit
+	TokenLimit Limit
+	Disabled   bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BlockLimit: DefaultBlockLimit,
+		IPLimit:    DefaultIPLimit,
+	}
+}
+
+// bucket is a single token bucket, refilled continuously at Burst/Window
+// tokens per nanosecond and capped at Burst.
+type bucket struct {
+	mu       sync.Mutex
+	limit    Limit
+	tokens   float64
+	lastFill time.Time
+}
+
+func newBucket(limit Limit) *bucket {
+	return &bucket{
+		limit:    limit,
+		tokens:   float64(limit.Burst),
+		lastFill: time.Now(),
+	}
+}
+
+// setLimit updates the limit a bucket refills against. Accumulated tokens
+// are left as-is (possibly above the new Burst, in which case they're
+// simply clamped down on the next take) so a config change never resets a
+// caller's existing budget.
+func (b *bucket) setLimit(limit Limit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+}
+
+// take reports whether a request may proceed, and if not, how long until
+// the next token is available.
+func (b *bucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.lastFill)
+	refillRate := float64(b.limit.Burst) / b.limit.Window.Seconds()
+	b.tokens += elapsed.Seconds() * refillRate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.lastFill = now
+
+	if b.tokens < 1 {
+		deficit := 1 - b.tokens
+		retryAfter := time.Duration(deficit/refillRate*1000) * time.Millisecond
+		return false, retryAfter
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (b *bucket) remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.tokens)
+}
+
+// Limiter tracks per-IP, per-block, and per-token buckets. The zero value
+// is not usable; construct with NewLimiter.
+type Limiter struct {
+	configMu sync.RWMutex
+	config   Config
+
+	mu      sync.Mutex
+	byIP    map[string]*bucket
+	byBlock map[string]*bucket
+	byToken map[string]*bucket
+}
+
+func NewLimiter(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		byIP:    make(map[string]*bucket),
+		byBlock: make(map[string]*bucket),
+		byToken: make(map[string]*bucket),
+	}
+}
+
+// UpdateConfig swaps in new limits for future Check calls. Existing
+// buckets keep their accumulated tokens and simply refill against the new
+// limit going forward. It's guarded by its own mutex (rather than the one
+// protecting the bucket maps) since checkAIChatRateLimit calls it on every
+// request, concurrently with Check reading the config on other requests.
+func (l *Limiter) UpdateConfig(config Config) {
+	l.configMu.Lock()
+	defer l.configMu.Unlock()
+	l.config = config
+}
+
+// getConfig returns a consistent snapshot of the current config for a
+// single Check call, so a concurrent UpdateConfig can't hand back a torn
+// mix of old and new limit fields.
+func (l *Limiter) getConfig() Config {
+	l.configMu.RLock()
+	defer l.configMu.RUnlock()
+	return l.config
+}
+
+// Result carries the outcome of a Check call along with the standard
+// RateLimit-* header values for whichever scope rejected the request.
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+	Limit      int
+	Remaining  int
+	Scope      string // "block", "ip", or "token"
+}
+
+// Check applies the block, IP, and token buckets (in that order) for the
+// given keys, creating buckets on first use. The first scope to reject the
+// request short-circuits the rest. The token bucket is skipped when
+// config.TokenLimit.Burst is zero.
+func (l *Limiter) Check(remoteIP, blockId, apiToken string) Result {
+	config := l.getConfig()
+	if config.Disabled {
+		return Result{Allowed: true}
+	}
+
+	if blockId != "" {
+		b := l.bucketFor(l.byBlock, blockId, config.BlockLimit)
+		if ok, retryAfter := b.take(); !ok {
+			return Result{Allowed: false, RetryAfter: retryAfter, Limit: config.BlockLimit.Burst, Remaining: 0, Scope: "block"}
+		}
+	}
+
+	if remoteIP != "" {
+		b := l.bucketFor(l.byIP, remoteIP, config.IPLimit)
+		if ok, retryAfter := b.take(); !ok {
+			return Result{Allowed: false, RetryAfter: retryAfter, Limit: config.IPLimit.Burst, Remaining: 0, Scope: "ip"}
+		}
+	}
+
+	if apiToken != "" && config.TokenLimit.Burst > 0 {
+		b := l.bucketFor(l.byToken, apiToken, config.TokenLimit)
+		if ok, retryAfter := b.take(); !ok {
+			return Result{Allowed: false, RetryAfter: retryAfter, Limit: config.TokenLimit.Burst, Remaining: 0, Scope: "token"}
+		}
+	}
+
+	return Result{Allowed: true}
+}
+
+// bucketFor returns the bucket for key, creating it against limit on first
+// use. An existing bucket has its limit refreshed to the latest value on
+// every call (not just at creation) so a live UpdateConfig actually takes
+// effect for callers that already have a bucket, not just brand-new ones.
+func (l *Limiter) bucketFor(buckets map[string]*bucket, key string, limit Limit) *bucket {
+	l.mu.Lock()
+	b, ok := buckets[key]
+	if !ok {
+		b = newBucket(limit)
+		buckets[key] = b
+	}
+	l.mu.Unlock()
+
+	if ok {
+		b.setLimit(limit)
+	}
+	return b
+}
+
+// RetryAfterHeader formats a duration as the integer-seconds string the
+// Retry-After header expects.
+func RetryAfterHeader(d time.Duration) string {
+	secs := int(d.Round(time.Second).Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return fmt.Sprintf("%d", secs)
+}
@@ -0,0 +1,71 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// reasoningModelPrefixes are matched via strings.HasPrefix against the
+// configured model id. These models expose a separate "thinking" channel
+// (OpenAI's ReasoningContent delta field, DeepSeek-R1's identical wire
+// shape) alongside the answer, and OpenAI's o-series additionally require
+// max_completion_tokens instead of max_tokens.
+var reasoningModelPrefixes = []string{
+	"o1",
+	"o3",
+	"o4",
+	"deepseek-r1",
+	"deepseek-reasoner",
+}
+
+// isReasoningModel reports whether model is a reasoning model in the
+// OpenAI-compatible wire format (o1/o3/o4, DeepSeek-R1) that streams
+// thinking tokens via Delta.ReasoningContent rather than Delta.Content.
+func isReasoningModel(model string) bool {
+	for _, prefix := range reasoningModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeReasoningStart/Delta/End mirror writeTextStart/writeUseChatTextDelta/
+// writeTextEnd but under their own frame types and id namespace, so the
+// frontend can render a model's thinking trace as a collapsible block
+// distinct from its answer.
+func writeReasoningStart(w http.ResponseWriter, reasoningId string) {
+	resp := map[string]interface{}{
+		"type": "reasoning-start",
+		"id":   reasoningId,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+func writeReasoningDelta(w http.ResponseWriter, reasoningId string, delta string) {
+	resp := map[string]interface{}{
+		"type":  "reasoning-delta",
+		"id":    reasoningId,
+		"delta": delta,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+func writeReasoningEnd(w http.ResponseWriter, reasoningId string) {
+	resp := map[string]interface{}{
+		"type": "reasoning-end",
+		"id":   reasoningId,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
@@ -0,0 +1,253 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chatSessionTTL is how long a finished session's frame buffer is kept
+// around so a client that reconnects shortly after a network blip can
+// still replay what it missed.
+const chatSessionTTL = 5 * time.Minute
+
+// sseFrame is one buffered, already-rendered SSE event (including its
+// "id:"/"data:" lines), tagged with the monotonic sequence number a
+// reconnecting client reports back via Last-Event-ID.
+type sseFrame struct {
+	seq  int
+	data string
+}
+
+// chatSession decouples an upstream provider stream from any single HTTP
+// response: the provider writes into the session via a sessionWriter, and
+// one or more HandleAIChat invocations (the original request, and any
+// reconnect after a dropped connection) subscribe to replay the buffered
+// frames and then relay whatever streams in live.
+type chatSession struct {
+	messageId string
+
+	mu        sync.Mutex
+	frames    []sseFrame
+	nextSeq   int
+	done      bool
+	expiresAt time.Time
+	subs      map[int]chan sseFrame
+	nextSubId int
+}
+
+func newChatSession(messageId string) *chatSession {
+	return &chatSession{
+		messageId: messageId,
+		subs:      make(map[int]chan sseFrame),
+	}
+}
+
+// emit fans a frame out to every currently-attached subscriber. When
+// withID is true, the frame is also assigned the next sequence number,
+// buffered for replay, and prefixed with its own "id: <messageId>:<seq>"
+// line, formatted under the same lock that assigns the sequence number --
+// so the id baked into the outgoing bytes can never diverge from the
+// frame's stored seq even when two goroutines (e.g. the keepalive ticker
+// and the upstream stream) call emit concurrently on the same session.
+// When withID is false (keepalive comments), the frame is neither
+// buffered nor given a sequence number.
+func (s *chatSession) emit(data string, withID bool) {
+	s.mu.Lock()
+	frame := sseFrame{seq: -1, data: data}
+	if withID {
+		frame.seq = s.nextSeq
+		frame.data = fmt.Sprintf("id: %s:%d\n%s", s.messageId, frame.seq, data)
+		s.nextSeq++
+		s.frames = append(s.frames, frame)
+	}
+	subs := make([]chan sseFrame, 0, len(s.subs))
+	for _, ch := range s.subs {
+		subs = append(subs, ch)
+	}
+	s.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- frame:
+		default:
+			// A slow live subscriber drops a frame rather than blocking
+			// the upstream stream; it can still recover it later via a
+			// Last-Event-ID reconnect against the buffer above.
+		}
+	}
+}
+
+// finish marks the session complete, closes every live subscriber channel
+// so their relay loops exit, and starts the TTL clock for eviction.
+func (s *chatSession) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.expiresAt = time.Now().Add(chatSessionTTL)
+	for id, ch := range s.subs {
+		close(ch)
+		delete(s.subs, id)
+	}
+}
+
+// subscribe returns every buffered frame after lastSeq (lastSeq of -1
+// means "from the start") plus, if the session is still live, a channel
+// for frames emitted from now on and an unsubscribe func to release it.
+// The final bool reports whether the session had already finished.
+func (s *chatSession) subscribe(lastSeq int) (backlog []sseFrame, live <-chan sseFrame, unsubscribe func(), alreadyDone bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.frames {
+		if f.seq > lastSeq {
+			backlog = append(backlog, f)
+		}
+	}
+
+	if s.done {
+		return backlog, nil, func() {}, true
+	}
+
+	id := s.nextSubId
+	s.nextSubId++
+	ch := make(chan sseFrame, 32)
+	s.subs[id] = ch
+	return backlog, ch, func() {
+		s.mu.Lock()
+		delete(s.subs, id)
+		s.mu.Unlock()
+	}, false
+}
+
+// chatSessionStore holds every in-flight or recently-finished session,
+// keyed by messageId.
+type chatSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*chatSession
+}
+
+var globalChatSessions = newChatSessionStore()
+
+func newChatSessionStore() *chatSessionStore {
+	store := &chatSessionStore{sessions: make(map[string]*chatSession)}
+	go store.sweepLoop()
+	return store
+}
+
+func (s *chatSessionStore) create(messageId string) *chatSession {
+	session := newChatSession(messageId)
+	s.mu.Lock()
+	s.sessions[messageId] = session
+	s.mu.Unlock()
+	return session
+}
+
+func (s *chatSessionStore) get(messageId string) (*chatSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[messageId]
+	return session, ok
+}
+
+func (s *chatSessionStore) sweepLoop() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		s.sweep(time.Now())
+	}
+}
+
+func (s *chatSessionStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		session.mu.Lock()
+		expired := session.done && now.After(session.expiresAt)
+		session.mu.Unlock()
+		if expired {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// sessionWriter is the http.ResponseWriter the detached upstream goroutine
+// writes into. It never touches a real network connection: every call to
+// Write buffers the frame (or, for keepalive comments, passes it straight
+// to live subscribers) on the session so the goroutine's lifetime is
+// independent of whatever HTTP request happens to be attached right now.
+type sessionWriter struct {
+	session *chatSession
+	header  http.Header
+}
+
+func newSessionWriter(session *chatSession) *sessionWriter {
+	return &sessionWriter{session: session, header: make(http.Header)}
+}
+
+func (sw *sessionWriter) Header() http.Header { return sw.header }
+
+func (sw *sessionWriter) WriteHeader(statusCode int) {}
+
+func (sw *sessionWriter) Write(p []byte) (int, error) {
+	text := string(p)
+	// Keepalive comments carry no state worth resuming, so they aren't
+	// tagged with an id line or a replayable sequence number.
+	if strings.HasPrefix(text, ":") {
+		sw.session.emit(text, false)
+		return len(p), nil
+	}
+	sw.session.emit(text, true)
+	return len(p), nil
+}
+
+// parseLastEventID splits the client-reported "<messageId>:<seq>" value.
+// The messageId half identifies which session to resume; the seq half is
+// the standard SSE Last-Event-ID position to resume after.
+func parseLastEventID(raw string) (messageId string, seq int, ok bool) {
+	idx := strings.LastIndex(raw, ":")
+	if idx < 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(raw[idx+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return raw[:idx], seq, true
+}
+
+// relaySession writes backlog frames (if resuming) then live frames to w
+// until the session finishes or the request's context is canceled (the
+// client disconnected again, in which case the upstream goroutine is left
+// running so a later reconnect can pick the session back up).
+func relaySession(ctx context.Context, w http.ResponseWriter, session *chatSession, lastSeq int) {
+	backlog, live, unsubscribe, alreadyDone := session.subscribe(lastSeq)
+	defer unsubscribe()
+
+	for _, f := range backlog {
+		fmt.Fprint(w, f.data)
+		tryFlush(w)
+	}
+	if alreadyDone {
+		return
+	}
+
+	for {
+		select {
+		case f, ok := <-live:
+			if !ok {
+				return
+			}
+			fmt.Fprint(w, f.data)
+			tryFlush(w)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
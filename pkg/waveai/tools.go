@@ -0,0 +1,313 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+	"github.com/wavetermdev/waveterm/pkg/validation"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// ToolHandler executes a registered tool call and returns the text to feed
+// back to the model as the corresponding tool-role message.
+type ToolHandler func(ctx context.Context, blockId string, args json.RawMessage) (string, error)
+
+// Tool describes a single callable function the model may invoke mid-
+// conversation, mirroring the tool-call event flow used by AI proxy
+// frameworks like Glide/LocalAI. Callers register the tools they want
+// available (e.g. run-command, read-file, list-blocks) and the registry
+// advertises them to every chat request.
+type Tool struct {
+	Name        string
+	Description string
+	JSONSchema  map[string]any
+	Handler     ToolHandler
+}
+
+var (
+	toolRegistryMu sync.RWMutex
+	toolRegistry   = map[string]Tool{}
+)
+
+// RegisterTool adds a tool to the global registry, replacing any existing
+// tool of the same name.
+func RegisterTool(tool Tool) {
+	toolRegistryMu.Lock()
+	defer toolRegistryMu.Unlock()
+	toolRegistry[tool.Name] = tool
+}
+
+func getTool(name string) (Tool, bool) {
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	tool, ok := toolRegistry[name]
+	return tool, ok
+}
+
+// toolsEnabled reports whether ai:tools:enabled has been turned on.
+// run-command and read-file can execute shell commands and read files on
+// the user's machine, so tools are never offered to a model unless a user
+// has explicitly opted in.
+func toolsEnabled() bool {
+	return wconfig.GetWatcher().GetFullConfig().Settings.AiToolsEnabled
+}
+
+// toolsForRequest returns the currently registered tools as go-openai tool
+// definitions, or nil if tool execution isn't enabled (see toolsEnabled)
+// or no tools are registered, so callers can skip setting req.Tools
+// entirely for backends/models that don't support it.
+func toolsForRequest() []openaiapi.Tool {
+	if !toolsEnabled() {
+		return nil
+	}
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	if len(toolRegistry) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(toolRegistry))
+	for name := range toolRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]openaiapi.Tool, 0, len(names))
+	for _, name := range names {
+		t := toolRegistry[name]
+		tools = append(tools, openaiapi.Tool{
+			Type: openaiapi.ToolTypeFunction,
+			Function: &openaiapi.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.JSONSchema,
+			},
+		})
+	}
+	return tools
+}
+
+// pendingToolCall accumulates one tool call's streamed id/name/argument
+// fragments until the model finishes emitting it.
+type pendingToolCall struct {
+	id        string
+	name      string
+	arguments string
+	started   bool
+}
+
+// toolCallAccumulator tracks every tool call in a single assistant turn,
+// keyed by the index go-openai assigns each one in the delta stream.
+type toolCallAccumulator struct {
+	byIndex map[int]*pendingToolCall
+	order   []int
+}
+
+func newToolCallAccumulator() *toolCallAccumulator {
+	return &toolCallAccumulator{byIndex: make(map[int]*pendingToolCall)}
+}
+
+func (a *toolCallAccumulator) empty() bool {
+	return len(a.byIndex) == 0
+}
+
+// addDelta folds one streamed ToolCalls delta into the accumulator,
+// emitting tool-input-start the first time a call's name is known and
+// tool-input-delta for every fragment of its JSON arguments.
+func (a *toolCallAccumulator) addDelta(w http.ResponseWriter, delta openaiapi.ToolCall) {
+	index := 0
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+	call, ok := a.byIndex[index]
+	if !ok {
+		call = &pendingToolCall{}
+		a.byIndex[index] = call
+		a.order = append(a.order, index)
+	}
+	if delta.ID != "" {
+		call.id = delta.ID
+	}
+	if delta.Function.Name != "" {
+		call.name = delta.Function.Name
+	}
+	if !call.started && call.id != "" && call.name != "" {
+		call.started = true
+		writeToolInputStart(w, call.id, call.name)
+	}
+	if delta.Function.Arguments != "" {
+		call.arguments += delta.Function.Arguments
+		if call.started {
+			writeToolInputDelta(w, call.id, delta.Function.Arguments)
+		}
+	}
+}
+
+// runAndAppend executes every accumulated tool call in order, emits
+// tool-input-available/tool-output-available frames for each, and returns
+// the assistant tool_calls message plus the tool-role result messages that
+// should be appended to the conversation before the next turn.
+func (a *toolCallAccumulator) runAndAppend(ctx context.Context, w http.ResponseWriter, blockId string) (openaiapi.ChatCompletionMessage, []openaiapi.ChatCompletionMessage) {
+	var assistantToolCalls []openaiapi.ToolCall
+	var toolMsgs []openaiapi.ChatCompletionMessage
+
+	indexes := append([]int(nil), a.order...)
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		call := a.byIndex[index]
+		writeToolInputAvailable(w, call.id, call.name, call.arguments)
+
+		output, err := executeTool(ctx, blockId, call.name, json.RawMessage(call.arguments))
+		if err != nil {
+			output = fmt.Sprintf("error: %v", err)
+		}
+		writeToolOutputAvailable(w, call.id, output)
+
+		assistantToolCalls = append(assistantToolCalls, openaiapi.ToolCall{
+			ID:   call.id,
+			Type: openaiapi.ToolTypeFunction,
+			Function: openaiapi.FunctionCall{
+				Name:      call.name,
+				Arguments: call.arguments,
+			},
+		})
+		toolMsgs = append(toolMsgs, openaiapi.ChatCompletionMessage{
+			Role:       "tool",
+			ToolCallID: call.id,
+			Content:    output,
+		})
+	}
+
+	assistantMsg := openaiapi.ChatCompletionMessage{
+		Role:      "assistant",
+		ToolCalls: assistantToolCalls,
+	}
+	return assistantMsg, toolMsgs
+}
+
+// executeTool looks up the named tool and runs its handler, gating shell
+// tools through validation.ValidateCommand first so a tool call can't be
+// used to smuggle a dangerous command past the same checks shell-invoking
+// code paths already enforce. It re-checks toolsEnabled() itself rather
+// than trusting that toolsForRequest() kept the tool out of the model's
+// hands, since the tool list is computed once per request and
+// ai:tools:enabled may be turned off before a later tool-calling turn.
+func executeTool(ctx context.Context, blockId string, name string, rawArgs json.RawMessage) (string, error) {
+	if !toolsEnabled() {
+		return "", fmt.Errorf("tool execution is disabled (set ai:tools:enabled to opt in)")
+	}
+
+	tool, ok := getTool(name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+
+	if name == "run-command" {
+		var args struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return "", fmt.Errorf("invalid arguments for %s: %v", name, err)
+		}
+		if err := validation.ValidateCommand(args.Command); err != nil {
+			return "", fmt.Errorf("command rejected: %v", err)
+		}
+	}
+
+	if name == "read-file" {
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return "", fmt.Errorf("invalid arguments for %s: %v", name, err)
+		}
+		if err := checkReadFileAllowlist(args.Path); err != nil {
+			return "", err
+		}
+	}
+
+	return tool.Handler(ctx, blockId, rawArgs)
+}
+
+// checkReadFileAllowlist rejects any path that doesn't resolve under one
+// of the ai:tools:readfileallowlist prefixes, so read-file can't be used
+// to exfiltrate arbitrary files (SSH keys, cloud credentials, etc.) just
+// because ai:tools:enabled is on.
+func checkReadFileAllowlist(path string) error {
+	allowlist := wconfig.GetWatcher().GetFullConfig().Settings.AiToolsReadFileAllowlist
+	if len(allowlist) == 0 {
+		return fmt.Errorf("read-file is disabled: ai:tools:readfileallowlist is empty")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid path %q: %v", path, err)
+	}
+	for _, prefix := range allowlist {
+		absPrefix, err := filepath.Abs(prefix)
+		if err != nil {
+			continue
+		}
+		if absPath == absPrefix || strings.HasPrefix(absPath, absPrefix+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("path %q is not under any ai:tools:readfileallowlist entry", path)
+}
+
+func writeToolInputStart(w http.ResponseWriter, toolCallId string, toolName string) {
+	resp := map[string]interface{}{
+		"type":       "tool-input-start",
+		"toolCallId": toolCallId,
+		"toolName":   toolName,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+func writeToolInputDelta(w http.ResponseWriter, toolCallId string, inputTextDelta string) {
+	resp := map[string]interface{}{
+		"type":           "tool-input-delta",
+		"toolCallId":     toolCallId,
+		"inputTextDelta": inputTextDelta,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+func writeToolInputAvailable(w http.ResponseWriter, toolCallId string, toolName string, argumentsJSON string) {
+	var input any
+	if err := json.Unmarshal([]byte(argumentsJSON), &input); err != nil {
+		input = argumentsJSON
+	}
+	resp := map[string]interface{}{
+		"type":       "tool-input-available",
+		"toolCallId": toolCallId,
+		"toolName":   toolName,
+		"input":      input,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+func writeToolOutputAvailable(w http.ResponseWriter, toolCallId string, output string) {
+	resp := map[string]interface{}{
+		"type":       "tool-output-available",
+		"toolCallId": toolCallId,
+		"output":     output,
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
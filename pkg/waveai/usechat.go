@@ -28,11 +28,30 @@ const (
 	UseChatConnection     = "keep-alive"
 )
 
+// defaultStreamTimeout bounds the detached provider goroutine when
+// ai:timeoutms isn't set, so a stalled upstream (a hung proxy, a
+// connection that never sends another byte) can't leak that goroutine and
+// its buffered chatSession forever.
+const defaultStreamTimeout = 5 * time.Minute
+
 // see /aiprompts/usechat-streamingproto.md for protocol
 
+// UseChatMessagePart covers both flavors of attachment the frontend sends:
+// "image" parts (image_url or inline base64 data) and "file" parts
+// (Vercel AI SDK UIMessage format, url + mediaType) -- image.go's
+// asImageAttachment normalizes either into a common shape.
 type UseChatMessagePart struct {
 	Type string `json:"type"`
 	Text string `json:"text"`
+
+	// "image" part fields
+	ImageURL string `json:"image_url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+
+	// "file" part fields
+	URL       string `json:"url,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
 }
 
 type UseChatMessage struct {
@@ -58,6 +77,18 @@ func (m *UseChatMessage) GetContent() string {
 	return ""
 }
 
+// GetImageAttachments returns every image part attached to the message,
+// normalized to a URL (remote or data:) plus its MIME type.
+func (m *UseChatMessage) GetImageAttachments() []imageAttachment {
+	var images []imageAttachment
+	for _, part := range m.Parts {
+		if att, ok := part.asImageAttachment(); ok {
+			images = append(images, att)
+		}
+	}
+	return images
+}
+
 type UseChatRequest struct {
 	Messages []UseChatMessage `json:"messages"`
 	Options  map[string]any   `json:"options,omitempty"`
@@ -261,7 +292,29 @@ func convertUseChatMessagesToPrompt(messages []UseChatMessage) []wshrpc.WaveAIPr
 	return prompt
 }
 
-func streamOpenAIToUseChat(w http.ResponseWriter, ctx context.Context, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage) {
+func streamOpenAIToUseChat(w http.ResponseWriter, ctx context.Context, blockId string, messageId string, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage) {
+	// Set up OpenAI client
+	clientConfig := openaiapi.DefaultConfig(opts.APIToken)
+	if opts.BaseURL != "" {
+		clientConfig.BaseURL = opts.BaseURL
+	}
+	if opts.OrgID != "" {
+		clientConfig.OrgID = opts.OrgID
+	}
+	if opts.APIVersion != "" {
+		clientConfig.APIVersion = opts.APIVersion
+	}
+
+	client := openaiapi.NewClientWithConfig(clientConfig)
+	streamOpenAIClientToUseChat(w, ctx, blockId, messageId, client, opts, messages)
+}
+
+// streamOpenAIClientToUseChat drives the go-openai chat completion stream
+// for an already-configured client and translates it into UseChat SSE
+// frames. Shared by the stock OpenAI provider, Azure OpenAI (different
+// client config, same wire protocol), and local llama.cpp/Ollama backends
+// that speak the OpenAI-compatible chat completions API.
+func streamOpenAIClientToUseChat(w http.ResponseWriter, ctx context.Context, blockId string, messageId string, client *openaiapi.Client, opts *wshrpc.WaveAIOptsType, messages []UseChatMessage) {
 	// Set up keepalive ticker immediately
 	keepaliveTicker := time.NewTicker(1 * time.Second)
 	defer keepaliveTicker.Stop()
@@ -286,120 +339,202 @@ func streamOpenAIToUseChat(w http.ResponseWriter, ctx context.Context, opts *wsh
 		}
 	}()
 
-	// Set up OpenAI client
-	clientConfig := openaiapi.DefaultConfig(opts.APIToken)
-	if opts.BaseURL != "" {
-		clientConfig.BaseURL = opts.BaseURL
-	}
-	if opts.OrgID != "" {
-		clientConfig.OrgID = opts.OrgID
-	}
-	if opts.APIVersion != "" {
-		clientConfig.APIVersion = opts.APIVersion
-	}
-
-	client := openaiapi.NewClientWithConfig(clientConfig)
-
 	// Convert messages, filtering out empty content
 	var openaiMessages []openaiapi.ChatCompletionMessage
 	for _, msg := range messages {
 		content := msg.GetContent()
-		// Skip messages with empty content as OpenAI requires non-empty content
-		if strings.TrimSpace(content) == "" {
+		images := msg.GetImageAttachments()
+		// Skip messages with no text and no attachments as OpenAI requires
+		// non-empty content
+		if strings.TrimSpace(content) == "" && len(images) == 0 {
 			continue
 		}
-		openaiMessages = append(openaiMessages, openaiapi.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: content,
-		})
-	}
 
-	// Create request
-	req := openaiapi.ChatCompletionRequest{
-		Model:    opts.Model,
-		Messages: openaiMessages,
-		Stream:   true,
-	}
-
-	if opts.MaxTokens > 0 {
-		if isReasoningModel(opts.Model) {
-			req.MaxCompletionTokens = opts.MaxTokens
-		} else {
-			req.MaxTokens = opts.MaxTokens
+		if len(images) == 0 || !modelSupportsVision(opts.Model) {
+			openaiMessages = append(openaiMessages, openaiapi.ChatCompletionMessage{
+				Role:    msg.Role,
+				Content: content,
+			})
+			continue
 		}
-	}
 
-	// Create stream
-	stream, err := client.CreateChatCompletionStream(ctx, req)
-	if err != nil {
-		// Send error in SSE format since headers are already sent
-		writeUseChatError(w, fmt.Sprintf("OpenAI API error: %v", err))
-		done <- true
-		return
+		// The model accepts vision input: send text and images together
+		// as MultiContent instead of collapsing to a Content string.
+		var parts []openaiapi.ChatMessagePart
+		if content != "" {
+			parts = append(parts, openaiapi.ChatMessagePart{Type: openaiapi.ChatMessagePartTypeText, Text: content})
+		}
+		for _, img := range images {
+			preparedURL, err := prepareImageForUpstream(img)
+			if err != nil {
+				log.Printf("skipping invalid image attachment: %v", err)
+				continue
+			}
+			parts = append(parts, openaiapi.ChatMessagePart{
+				Type:     openaiapi.ChatMessagePartTypeImageURL,
+				ImageURL: &openaiapi.ChatMessageImageURL{URL: preparedURL},
+			})
+		}
+		openaiMessages = append(openaiMessages, openaiapi.ChatCompletionMessage{
+			Role:         msg.Role,
+			MultiContent: parts,
+		})
 	}
-	defer stream.Close()
 
-	// Generate IDs for the streaming protocol - use shorter, simpler IDs
-	messageId := generateID()
-	textId := generateID()
+	tools := toolsForRequest()
 
-	// Send message start
+	// messageId is shared across however many tool-calling round trips it
+	// takes to reach a final answer (the frontend treats them as one
+	// logical message) and, now, across any reconnect that resumes this
+	// same chat session.
 	writeMessageStart(w, messageId)
 	tryFlush(w)
 
-	// Track whether we've started text streaming
-	textStarted := false
-	textEnded := false
-
-	// Stream responses
-	for {
-		response, err := stream.Recv()
-		if err == io.EOF {
-			// Send text end and finish if text was started but not ended
-			if textStarted && !textEnded {
-				writeTextEnd(w, textId)
-				textEnded = true
+	// A single chat turn may ask for tool calls instead of answering, in
+	// which case we execute the tools, append the results to the
+	// conversation, and loop for another turn. maxToolTurns bounds that
+	// loop so a misbehaving model can't hold the connection open forever.
+	// totalUsage accumulates every turn's token usage across however many
+	// tool-calling round trips the conversation takes, so a multi-turn
+	// tool-using chat reports/persists its real total rather than just the
+	// final turn's numbers.
+	var totalUsage OpenAIUsageResponse
+	var haveUsage bool
+
+	const maxToolTurns = 8
+	for turn := 0; turn < maxToolTurns; turn++ {
+		req := openaiapi.ChatCompletionRequest{
+			Model:    opts.Model,
+			Messages: openaiMessages,
+			Stream:   true,
+		}
+		if len(tools) > 0 {
+			req.Tools = tools
+		}
+		if opts.MaxTokens > 0 {
+			if isReasoningModel(opts.Model) {
+				req.MaxCompletionTokens = opts.MaxTokens
+			} else {
+				req.MaxTokens = opts.MaxTokens
 			}
-			writeOpenAIFinish(w, "stop", nil)
-			writeUseChatDone(w)
-			done <- true
-			return
 		}
+
+		stream, err := client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
 			// Send error in SSE format since headers are already sent
-			writeUseChatError(w, fmt.Sprintf("Stream error: %v", err))
+			writeUseChatError(w, fmt.Sprintf("OpenAI API error: %v", err))
 			done <- true
 			return
 		}
 
-		// Process choices
-		for _, choice := range response.Choices {
-			if choice.Delta.Content != "" {
-				// Send text start only when we have actual content
-				if !textStarted {
-					writeTextStart(w, textId)
-					textStarted = true
+		// Rate limit headers are set on the initial HTTP response, so
+		// they're available as soon as the stream is established.
+		rateLimitHeaders := stream.GetRateLimitHeaders()
+
+		textId := generateID()
+		textStarted := false
+		textEnded := false
+		reasoningId := generateID()
+		reasoningStarted := false
+		reasoningEnded := false
+		var lastUsage *OpenAIUsageResponse
+		var finishReason string
+		toolCalls := newToolCallAccumulator()
+
+		for {
+			response, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				stream.Close()
+				writeUseChatError(w, fmt.Sprintf("Stream error: %v", err))
+				done <- true
+				return
+			}
+
+			if response.Usage != nil && response.Usage.PromptTokens > 0 {
+				lastUsage = &OpenAIUsageResponse{
+					PromptTokens:     response.Usage.PromptTokens,
+					CompletionTokens: response.Usage.CompletionTokens,
+					TotalTokens:      response.Usage.TotalTokens,
 				}
-				writeUseChatTextDelta(w, textId, choice.Delta.Content)
 			}
-			if choice.FinishReason != "" {
-				usage := &OpenAIUsageResponse{}
-				if response.Usage != nil && response.Usage.PromptTokens > 0 {
-					usage.PromptTokens = response.Usage.PromptTokens
-					usage.CompletionTokens = response.Usage.CompletionTokens
-					usage.TotalTokens = response.Usage.TotalTokens
+
+			for _, choice := range response.Choices {
+				if choice.Delta.ReasoningContent != "" {
+					if !reasoningStarted {
+						writeReasoningStart(w, reasoningId)
+						reasoningStarted = true
+					}
+					writeReasoningDelta(w, reasoningId, choice.Delta.ReasoningContent)
 				}
-				if textStarted && !textEnded {
-					writeTextEnd(w, textId)
-					textEnded = true
+				if choice.Delta.Content != "" {
+					// The model has moved on to its answer: close the
+					// reasoning frame (if any) before opening the text one,
+					// so reasoning always finishes before text starts.
+					if reasoningStarted && !reasoningEnded {
+						writeReasoningEnd(w, reasoningId)
+						reasoningEnded = true
+					}
+					// Send text start only when we have actual content
+					if !textStarted {
+						writeTextStart(w, textId)
+						textStarted = true
+					}
+					writeUseChatTextDelta(w, textId, choice.Delta.Content)
+				}
+				for _, delta := range choice.Delta.ToolCalls {
+					toolCalls.addDelta(w, delta)
+				}
+				if choice.FinishReason != "" {
+					finishReason = string(choice.FinishReason)
 				}
-				writeOpenAIFinish(w, string(choice.FinishReason), usage)
 			}
+
+			tryFlush(w)
+		}
+		stream.Close()
+
+		if lastUsage != nil {
+			totalUsage.PromptTokens += lastUsage.PromptTokens
+			totalUsage.CompletionTokens += lastUsage.CompletionTokens
+			totalUsage.TotalTokens += lastUsage.TotalTokens
+			haveUsage = true
+		}
+
+		if reasoningStarted && !reasoningEnded {
+			writeReasoningEnd(w, reasoningId)
+			reasoningEnded = true
+		}
+		if textStarted && !textEnded {
+			writeTextEnd(w, textId)
+			textEnded = true
 		}
 
-		// Flush the response
-		tryFlush(w)
+		if finishReason != string(openaiapi.FinishReasonToolCalls) || toolCalls.empty() {
+			var usage *OpenAIUsageResponse
+			if haveUsage {
+				usage = &totalUsage
+			}
+			writeUseChatMetadata(w, opts.Model, usage, rateLimitHeaders)
+			writeOpenAIFinish(w, finishReason, usage)
+			persistBlockAIUsage(ctx, blockId, usage)
+			writeUseChatDone(w)
+			done <- true
+			return
+		}
+
+		// The model wants to call tools: announce each call's fully
+		// accumulated input, run it server-side, report the output, and
+		// feed the result back in as a tool message for the next turn.
+		assistantMsg, toolResultMsgs := toolCalls.runAndAppend(ctx, w, blockId)
+		openaiMessages = append(openaiMessages, assistantMsg)
+		openaiMessages = append(openaiMessages, toolResultMsgs...)
 	}
+
+	writeUseChatError(w, "tool call loop exceeded max turns")
+	done <- true
 }
 
 func writeMessageStart(w http.ResponseWriter, messageId string) {
@@ -443,6 +578,62 @@ func writeTextEnd(w http.ResponseWriter, textId string) {
 	tryFlush(w)
 }
 
+// writeUseChatMetadata emits usage and rate-limit information ahead of the
+// finish frame so the frontend can display quotas/costs without waiting
+// for a separate round trip. rateLimitHeaders may be a zero value if the
+// upstream response didn't include any.
+func writeUseChatMetadata(w http.ResponseWriter, model string, usage *OpenAIUsageResponse, rateLimitHeaders openaiapi.RateLimitHeaders) {
+	resp := map[string]interface{}{
+		"type":               "metadata",
+		"model":              model,
+		"rateLimitRemaining": rateLimitHeaders.RemainingRequests,
+		"rateLimitReset":     rateLimitHeaders.ResetRequests.String(),
+	}
+	if usage != nil {
+		resp["promptTokens"] = usage.PromptTokens
+		resp["completionTokens"] = usage.CompletionTokens
+		resp["totalTokens"] = usage.TotalTokens
+	}
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	tryFlush(w)
+}
+
+// persistBlockAIUsage adds this turn's token usage onto the block's
+// cumulative ai:usage:* metadata so the UI can show running quotas/costs
+// without re-summing every message in the chat. Best-effort: a failure to
+// persist usage should never fail the chat response itself.
+func persistBlockAIUsage(ctx context.Context, blockId string, usage *OpenAIUsageResponse) {
+	if usage == nil || blockId == "" {
+		return
+	}
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
+	if err != nil {
+		log.Printf("failed to load block %s for AI usage tracking: %v", blockId, err)
+		return
+	}
+	if block.Meta == nil {
+		block.Meta = make(waveobj.MetaMapType)
+	}
+	block.Meta["ai:usage:prompttokens"] = toInt(block.Meta["ai:usage:prompttokens"]) + usage.PromptTokens
+	block.Meta["ai:usage:completiontokens"] = toInt(block.Meta["ai:usage:completiontokens"]) + usage.CompletionTokens
+	block.Meta["ai:usage:totaltokens"] = toInt(block.Meta["ai:usage:totaltokens"]) + usage.TotalTokens
+	if err := wstore.UpdateObjectMeta(ctx, waveobj.MakeORef(waveobj.OType_Block, blockId), block.Meta); err != nil {
+		log.Printf("failed to persist AI usage for block %s: %v", blockId, err)
+	}
+}
+
+func toInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
 func writeOpenAIFinish(w http.ResponseWriter, finishReason string, usage *OpenAIUsageResponse) {
 	resp := map[string]interface{}{
 		"type": "finish",
@@ -519,17 +710,25 @@ func HandleAIChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, only support OpenAI
-	if aiOpts.APIType != APIType_OpenAI && aiOpts.APIType != "" {
-		http.Error(w, fmt.Sprintf("Unsupported API type: %s (only OpenAI supported in POC)", aiOpts.APIType), http.StatusBadRequest)
+	provider, err := getAIProvider(aiOpts.APIType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if aiOpts.APIToken == "" {
+	// Local/Ollama-style backends typically don't check the key at all
+	// (provider_local.go substitutes a placeholder token for them), so
+	// only require one for backends that actually authenticate with it.
+	if aiOpts.APIToken == "" && aiOpts.APIType != APIType_Local {
 		http.Error(w, "No API token provided", http.StatusBadRequest)
 		return
 	}
 
+	if result := checkAIChatRateLimit(r, blockId, aiOpts.APIToken); !result.Allowed {
+		writeRateLimitExceeded(w, result)
+		return
+	}
+
 	// Reset write deadline for streaming to prevent timeouts
 	rc := http.NewResponseController(w)
 	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
@@ -549,6 +748,40 @@ func HandleAIChat(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, ": stream-start\n\n") // Send initial SSE comment
 	tryFlush(w)
 
-	// Stream OpenAI response
-	streamOpenAIToUseChat(w, r.Context(), aiOpts, req.Messages)
+	// A Last-Event-ID of "<messageId>:<seq>" means the client is
+	// reconnecting mid-stream: reattach to the still-buffering (or
+	// already-finished) session instead of starting a new provider call.
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if messageId, lastSeq, ok := parseLastEventID(lastEventID); ok {
+			if session, ok := globalChatSessions.get(messageId); ok {
+				relaySession(r.Context(), w, session, lastSeq)
+				return
+			}
+		}
+		// Session expired or unknown: fall through and start a fresh one.
+	}
+
+	messageId := generateID()
+	session := globalChatSessions.create(messageId)
+
+	// The provider call runs detached from this request's context so a
+	// dropped client connection doesn't cancel the in-flight upstream
+	// stream; it keeps buffering into the session for a future reconnect.
+	// It's still bounded by ai:timeoutms (or defaultStreamTimeout), though,
+	// so a stalled upstream can't leak the goroutine/session forever.
+	streamTimeout := defaultStreamTimeout
+	if aiOpts.TimeoutMs > 0 {
+		streamTimeout = time.Duration(aiOpts.TimeoutMs) * time.Millisecond
+	}
+	go func() {
+		streamCtx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+		defer cancel()
+		sw := newSessionWriter(session)
+		if err := provider.StreamChat(streamCtx, blockId, messageId, aiOpts, req.Messages, sw); err != nil {
+			writeUseChatError(sw, err.Error())
+		}
+		session.finish()
+	}()
+
+	relaySession(r.Context(), w, session, -1)
 }
@@ -0,0 +1,75 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wconfig
+
+import "sync"
+
+// SettingsType is the subset of the global settings.json schema that
+// pkg/waveai reads. AiPreset already existed; the AiRateLimit* fields are
+// added here alongside pkg/waveai/ratelimit.go, which is the only code
+// that reads them.
+type SettingsType struct {
+	AiPreset     string `json:"ai:preset,omitempty"`
+	AiApiType    string `json:"ai:apitype,omitempty"`
+	AiApiToken   string `json:"ai:apitoken,omitempty"`
+	AiBaseURL    string `json:"ai:baseurl,omitempty"`
+	AiModel      string `json:"ai:model,omitempty"`
+	AiOrgID      string `json:"ai:orgid,omitempty"`
+	AIApiVersion string `json:"ai:apiversion,omitempty"`
+	AiProxyUrl   string `json:"ai:proxyurl,omitempty"`
+
+	// AiRateLimit* configure HandleAIChat's per-block/per-IP token-bucket
+	// rate limiter (see pkg/waveai/ratelimit.go and
+	// pkg/waveai/ratelimit/ratelimit.go). Zero values mean "use
+	// ratelimit.DefaultConfig()'s built-in limit".
+	AiRateLimitDisabled    bool `json:"ai:ratelimit:disabled,omitempty"`
+	AiRateLimitBlockPerMin int  `json:"ai:ratelimit:blockperminute,omitempty"`
+	AiRateLimitIPPerWindow int  `json:"ai:ratelimit:ipperwindow,omitempty"`
+	AiRateLimitIPWindowMin int  `json:"ai:ratelimit:ipwindowminutes,omitempty"`
+
+	// AiMaxTokens and AiTimeoutMs are the global fallbacks resolveAIConfig
+	// uses when neither the request, the block's metadata, nor the active
+	// preset sets ai:maxtokens / ai:timeoutms (see pkg/waveai/usechat.go).
+	AiMaxTokens int `json:"ai:maxtokens,omitempty"`
+	AiTimeoutMs int `json:"ai:timeoutms,omitempty"`
+
+	// AiToolsEnabled opts in to the run-command/read-file/list-blocks tool
+	// handlers in pkg/waveai/builtin_tools.go. Those let a model execute
+	// shell commands and read files on the user's machine, so they stay
+	// off until a user explicitly turns this on.
+	AiToolsEnabled bool `json:"ai:tools:enabled,omitempty"`
+
+	// AiToolsReadFileAllowlist restricts the read-file tool to paths under
+	// one of these prefixes. Empty (the default) means read-file can't
+	// read anything, even if AiToolsEnabled is true.
+	AiToolsReadFileAllowlist []string `json:"ai:tools:readfileallowlist,omitempty"`
+}
+
+// FullConfigType is the resolved settings.json + presets.json view handed
+// to request handlers.
+type FullConfigType struct {
+	Settings SettingsType
+	Presets  map[string]map[string]any
+}
+
+// Watcher holds the most recently loaded FullConfigType and keeps it
+// current as settings.json/presets.json change on disk.
+type Watcher struct {
+	mu     sync.RWMutex
+	config FullConfigType
+}
+
+var globalWatcher = &Watcher{}
+
+// GetWatcher returns the process-wide settings watcher.
+func GetWatcher() *Watcher {
+	return globalWatcher
+}
+
+// GetFullConfig returns the watcher's current config snapshot.
+func (w *Watcher) GetFullConfig() FullConfigType {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config
+}